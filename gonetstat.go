@@ -9,14 +9,15 @@
 package GOnetstat
 
 import (
+    "context"
+    "encoding/hex"
     "fmt"
     "io/ioutil"
+    "net"
     "strings"
     "os"
     "os/user"
     "strconv"
-    "path/filepath"
-    "regexp"
 )
 
 
@@ -66,119 +67,88 @@ type Process struct {
     Port         int64
     ForeignIP    string
     ForeignPort  int64
+
+    // The following are only populated by the NETLINK_INET_DIAG backend
+    // (TcpDiag, UdpDiag, Tcp6Diag, Udp6Diag); the /proc/net/tcp* backend
+    // leaves them at their zero value.
+    Rtt                 int64
+    Cwnd                int64
+    Rmem                int64
+    Wmem                int64
+    Retransmits         int64
+    CongestionAlgorithm string
 }
 
 
-func getData(t string) []string {
+func getData(t string) ([]string, error) {
     // Get data from tcp or udp file.
 
     var procT string
 
-    if t == "tcp" {
+    switch t {
+    case "tcp":
         procT = PROC_TCP
-    } else if t == "udp" {
+    case "udp":
         procT = PROC_UDP
-    } else if t == "tcp6" {
+    case "tcp6":
         procT = PROC_TCP6
-    } else if t == "udp6" {
+    case "udp6":
         procT = PROC_UDP6
-    } else {
-        fmt.Printf("%s is a invalid type, tcp and udp only!\n", t)
-        os.Exit(1)
+    default:
+        return nil, fmt.Errorf("%s is a invalid type, tcp, udp, tcp6 and udp6 only", t)
     }
 
+    return getDataFile(procT)
+}
+
+
+func getDataFile(path string) ([]string, error) {
+    // Read a /proc/net/* style file and strip the header line and the
+    // blank line on the end.
 
-    data, err := ioutil.ReadFile(procT)
+    data, err := ioutil.ReadFile(path)
     if err != nil {
-        fmt.Println(err)
-        os.Exit(1)
+        return nil, fmt.Errorf("read %s: %w", path, err)
     }
     lines := strings.Split(string(data), "\n")
-
-    // Return lines without Header line and blank line on the end
-    return lines[1:len(lines) - 1]
-
+    return lines[1:len(lines) - 1], nil
 }
 
 
-func hexToDec(h string) int64 {
+func hexToDec(h string) (int64, error) {
     // convert hexadecimal to decimal.
     d, err := strconv.ParseInt(h, 16, 32)
     if err != nil {
-        fmt.Println(err)
-        os.Exit(1)
+        return 0, fmt.Errorf("parse hex %q: %w", h, err)
     }
 
-    return d
+    return d, nil
 }
 
 
-func convertIP(ip string) string {
-    // Convert the ipv4 to decimal. Have to rearrange the ip because the
-    // default value is in little Endian order.
-
-    var out string
-
-    // Check ip size if greater than 8 is a ipv6 type
-    if len(ip) > 8 {
-        i := []string{ ip[30:32],
-                        ip[28:30],
-                        ip[26:28],
-                        ip[24:26],
-                        ip[22:24],
-                        ip[20:22],
-                        ip[18:20],
-                        ip[16:18],
-                        ip[14:16],
-                        ip[12:14],
-                        ip[10:12],
-                        ip[8:10],
-                        ip[6:8],
-                        ip[4:6],
-                        ip[2:4],
-                        ip[0:2]}
-        out = fmt.Sprintf("%v%v:%v%v:%v%v:%v%v:%v%v:%v%v:%v%v:%v%v",
-                            i[14], i[15], i[13], i[12],
-                            i[10], i[11], i[8], i[9],
-                            i[6],  i[7], i[4], i[5],
-                            i[2], i[3], i[0], i[1])
-
-    } else {
-        i := []int64{ hexToDec(ip[6:8]),
-                       hexToDec(ip[4:6]),
-                       hexToDec(ip[2:4]),
-                       hexToDec(ip[0:2]) }
-
-       out = fmt.Sprintf("%v.%v.%v.%v", i[0], i[1], i[2], i[3])
-    }
-   return out
-}
+func convertIP(ip string) (string, error) {
+    // /proc/net/tcp* writes an IPv4 address as one 32-bit word, and an
+    // IPv6 address as four, each word in host byte order. Decode the hex
+    // into raw bytes, reverse each 4-byte word back into network byte
+    // order, and let net.IP do the canonical formatting (so "::1" prints
+    // as "::1", not "0000:0000:...:0001").
 
-
-func findPid(inode string) string {
-    // Loop through all fd dirs of process on /proc to compare the inode and
-    // get the pid.
-
-    pid := "-"
-
-    d, err := filepath.Glob("/proc/[0-9]*/fd/[0-9]*")
+    raw, err := hex.DecodeString(ip)
     if err != nil {
-        fmt.Println(err)
-        os.Exit(1)
+        return "", fmt.Errorf("convert ip %q: %w", ip, err)
+    }
+    if len(raw) != 4 && len(raw) != 16 {
+        return "", fmt.Errorf("convert ip %q: want 4 or 16 bytes, got %d", ip, len(raw))
     }
 
-    re := regexp.MustCompile(inode)
-    for _, item := range(d) {
-        path, err := os.Readlink(item)
-        if err != nil {
-          continue
-        }
-        out := re.FindString(path)
-        if len(out) != 0 {
-            pid = strings.Split(item, "/")[2]
+    addr := make(net.IP, len(raw))
+    for word := 0; word < len(raw); word += 4 {
+        for i := 0; i < 4; i++ {
+            addr[word+i] = raw[word+3-i]
         }
     }
-    return pid
+
+    return addr.String(), nil
 }
 
 
@@ -216,43 +186,56 @@ func removeEmpty(array []string) []string {
 }
 
 
-func netstat(t string) []Process {
+func netstat(t string, index map[uint64]ProcRef) ([]Process, error) {
     // Return a array of Process with Name, Ip, Port, State .. etc
     // Require Root acess to get information about some processes.
 
     var Processes []Process
 
-    data := getData(t)
+    data, err := getData(t)
+    if err != nil {
+        return nil, fmt.Errorf("netstat %s: %w", t, err)
+    }
 
     for _, line := range(data) {
 
         // local ip and port
         lineArray := removeEmpty(strings.Split(strings.TrimSpace(line), " "))
         ipPort := strings.Split(lineArray[1], ":")
-        ip := convertIP(ipPort[0])
-        port := hexToDec(ipPort[1])
+        ip, err := convertIP(ipPort[0])
+        if err != nil {
+            return nil, fmt.Errorf("netstat %s: %w", t, err)
+        }
+        port, err := hexToDec(ipPort[1])
+        if err != nil {
+            return nil, fmt.Errorf("netstat %s: %w", t, err)
+        }
 
         // foreign ip and port
         fipPort := strings.Split(lineArray[2], ":")
-        fip := convertIP(fipPort[0])
-        fport := hexToDec(fipPort[1])
+        fip, err := convertIP(fipPort[0])
+        if err != nil {
+            return nil, fmt.Errorf("netstat %s: %w", t, err)
+        }
+        fport, err := hexToDec(fipPort[1])
+        if err != nil {
+            return nil, fmt.Errorf("netstat %s: %w", t, err)
+        }
 
         state := lineArray[3]
-        // uid := getUser(lineArray[7])
-        // pid := findPid(lineArray[9])
-        // exe, err := getProcessExe(pid)
-        // name := "-"
-        // if err != nil {
-        //   fmt.Printf("Couldn't find process exec located at /proc/%s/exe\n", pid)
-        // } else {
-        //   name = getProcessName(exe)
-        // }
+
+        ref := ProcRef{Pid: "-", Name: "-", Exe: "-", User: "-"}
+        if inode, err := strconv.ParseUint(lineArray[9], 10, 64); err == nil {
+            if r, ok := index[inode]; ok {
+                ref = r
+            }
+        }
 
         p := Process{
-          // User: uid,
-          // Name: name,
-          // Pid: pid,
-          // Exe: exe,
+          User: ref.User,
+          Name: ref.Name,
+          Pid: ref.Pid,
+          Exe: ref.Exe,
           State: state,
           IP: ip,
           Port: port,
@@ -264,33 +247,103 @@ func netstat(t string) []Process {
 
     }
 
-    return Processes
+    return Processes, nil
 }
 
 
+func TcpContext(ctx context.Context) ([]Process, error) {
+    // Get a slice of Process type with TCP data.
+    index, err := BuildInodeIndexContext(ctx)
+    if err != nil {
+        return nil, err
+    }
+    return netstat("tcp", index)
+}
+
+
+func UdpContext(ctx context.Context) ([]Process, error) {
+    // Get a slice of Process type with UDP data.
+    index, err := BuildInodeIndexContext(ctx)
+    if err != nil {
+        return nil, err
+    }
+    return netstat("udp", index)
+}
+
+
+func Tcp6Context(ctx context.Context) ([]Process, error) {
+    // Get a slice of Process type with TCP6 data.
+    index, err := BuildInodeIndexContext(ctx)
+    if err != nil {
+        return nil, err
+    }
+    return netstat("tcp6", index)
+}
+
+
+func Udp6Context(ctx context.Context) ([]Process, error) {
+    // Get a slice of Process type with UDP6 data.
+    index, err := BuildInodeIndexContext(ctx)
+    if err != nil {
+        return nil, err
+    }
+    return netstat("udp6", index)
+}
+
+
+// Deprecated: use TcpContext instead. Tcp keeps the original no-context,
+// no-error signature so existing callers keep compiling; any error is
+// swallowed and an empty slice is returned in its place.
 func Tcp() []Process {
-    // Get a slice of Process type with TCP data
-    data := netstat("tcp")
-    return data
+    p, _ := TcpContext(context.Background())
+    return p
 }
 
 
+// Deprecated: use UdpContext instead.
 func Udp() []Process {
-    // Get a slice of Process type with UDP data
-    data := netstat("udp")
-    return data
+    p, _ := UdpContext(context.Background())
+    return p
 }
 
 
+// Deprecated: use Tcp6Context instead.
 func Tcp6() []Process {
-    // Get a slice of Process type with TCP6 data
-    data := netstat("tcp6")
-    return data
+    p, _ := Tcp6Context(context.Background())
+    return p
 }
 
 
+// Deprecated: use Udp6Context instead.
 func Udp6() []Process {
-    // Get a slice of Process type with UDP6 data
-    data := netstat("udp6")
-    return data
+    p, _ := Udp6Context(context.Background())
+    return p
+}
+
+
+func TcpWithIndex(index map[uint64]ProcRef) ([]Process, error) {
+    // Get a slice of Process type with TCP data, reusing an inode index
+    // built by a caller that polls repeatedly (see BuildInodeIndex).
+    return netstat("tcp", index)
+}
+
+
+func UdpWithIndex(index map[uint64]ProcRef) ([]Process, error) {
+    // Get a slice of Process type with UDP data, reusing an inode index
+    // built by a caller that polls repeatedly (see BuildInodeIndex).
+    return netstat("udp", index)
+}
+
+
+func Tcp6WithIndex(index map[uint64]ProcRef) ([]Process, error) {
+    // Get a slice of Process type with TCP6 data, reusing an inode index
+    // built by a caller that polls repeatedly (see BuildInodeIndex).
+    return netstat("tcp6", index)
+}
+
+
+func Udp6WithIndex(index map[uint64]ProcRef) ([]Process, error) {
+    // Get a slice of Process type with UDP6 data, reusing an inode index
+    // built by a caller that polls repeatedly (see BuildInodeIndex).
+    return netstat("udp6", index)
 }
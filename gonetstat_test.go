@@ -0,0 +1,43 @@
+package GOnetstat
+
+import "testing"
+
+func TestConvertIP(t *testing.T) {
+    cases := []struct {
+        name string
+        hex  string
+        want string
+    }{
+        // LISTEN on :: (wildcard v6), as seen in /proc/net/tcp6 for sshd.
+        {"listen-wildcard-v6", "00000000000000000000000000000000", "::"},
+        {"loopback-v6", "00000000000000000000000001000000", "::1"},
+        // net.IP.String() renders IPv4-mapped IPv6 addresses in dotted
+        // form, matching what net.ParseIP("::ffff:1.2.3.4").String() gives.
+        {"ipv4-mapped-v6", "0000000000000000FFFF000004030201", "1.2.3.4"},
+        {"link-local-v6", "000080FE000000000000000001000000", "fe80::1"},
+        {"loopback-v4", "0100007F", "127.0.0.1"},
+        {"standard-v4", "0501A8C0", "192.168.1.5"},
+    }
+
+    for _, c := range cases {
+        t.Run(c.name, func(t *testing.T) {
+            got, err := convertIP(c.hex)
+            if err != nil {
+                t.Fatalf("convertIP(%q) returned error: %v", c.hex, err)
+            }
+            if got != c.want {
+                t.Errorf("convertIP(%q) = %q, want %q", c.hex, got, c.want)
+            }
+        })
+    }
+}
+
+
+func TestConvertIPInvalid(t *testing.T) {
+    if _, err := convertIP("not-hex"); err == nil {
+        t.Error("convertIP with non-hex input: want error, got nil")
+    }
+    if _, err := convertIP("0011"); err == nil {
+        t.Error("convertIP with a short, non 4/16-byte address: want error, got nil")
+    }
+}
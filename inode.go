@@ -0,0 +1,138 @@
+/*
+    One-shot inode -> pid index.
+
+    findPid used to reglob every /proc/<pid>/fd/<fd> entry and readlink
+    it, for every socket, which is O(sockets x fds) syscalls on busy
+    hosts. BuildInodeIndex walks /proc/<pid>/fd once and returns a map that
+    netstat() (and any caller polling repeatedly) can reuse in O(1) per
+    lookup.
+
+    Author: Rafael Santos <rafael@sourcecode.net.br>
+*/
+
+package GOnetstat
+
+import (
+    "context"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+var socketInodeRe = regexp.MustCompile(`^socket:\[(\d+)\]$`)
+
+
+// ProcRef identifies the process that owns a socket inode.
+type ProcRef struct {
+    Pid  string
+    User string
+    Name string
+    Exe  string
+}
+
+
+// BuildInodeIndexContext walks every /proc/<pid>/fd entry once and returns
+// a map of socket inode -> owning process. Callers that poll repeatedly
+// (e.g. a Watcher) should build the index once and reuse it across ticks
+// via TcpWithIndex/UdpWithIndex/Tcp6WithIndex/Udp6WithIndex instead of
+// calling Tcp()/Udp()/... which rebuilds it every time. The walk is
+// checked against ctx between pids, since it can be slow on hosts with
+// tens of thousands of fds.
+func BuildInodeIndexContext(ctx context.Context) (map[uint64]ProcRef, error) {
+    index := make(map[uint64]ProcRef)
+
+    pidDirs, err := ioutil.ReadDir("/proc")
+    if err != nil {
+        return nil, fmt.Errorf("read /proc: %w", err)
+    }
+
+    for _, pidDir := range pidDirs {
+        if err := ctx.Err(); err != nil {
+            return nil, fmt.Errorf("build inode index: %w", err)
+        }
+
+        pid := pidDir.Name()
+        if _, err := strconv.Atoi(pid); err != nil {
+            continue
+        }
+
+        fds, err := filepath.Glob(fmt.Sprintf("/proc/%s/fd/*", pid))
+        if err != nil || len(fds) == 0 {
+            continue
+        }
+
+        var ref *ProcRef
+
+        for _, fd := range fds {
+            target, err := os.Readlink(fd)
+            if err != nil {
+                continue
+            }
+
+            m := socketInodeRe.FindStringSubmatch(target)
+            if m == nil {
+                continue
+            }
+
+            inode, err := strconv.ParseUint(m[1], 10, 64)
+            if err != nil {
+                continue
+            }
+
+            if ref == nil {
+                ref = procRefFor(pid)
+            }
+            index[inode] = *ref
+        }
+    }
+
+    return index, nil
+}
+
+
+// Deprecated: use BuildInodeIndexContext instead. BuildInodeIndex keeps
+// the original no-context signature so existing callers keep compiling.
+func BuildInodeIndex() (map[uint64]ProcRef, error) {
+    return BuildInodeIndexContext(context.Background())
+}
+
+
+// procRefFor resolves the user, exe and process name for a pid, falling
+// back to "-" for anything that can't be read (permission denied, pid
+// exited mid-walk, ...).
+func procRefFor(pid string) *ProcRef {
+    exe, err := getProcessExe(pid)
+    name := "-"
+    if err != nil {
+        exe = "-"
+    } else {
+        name = getProcessName(exe)
+    }
+
+    uid := "-"
+    if status, err := ioutil.ReadFile(fmt.Sprintf("/proc/%s/status", pid)); err == nil {
+        for _, line := range strings.Split(string(status), "\n") {
+            if strings.HasPrefix(line, "Uid:") {
+                fields := removeEmpty(strings.Split(line, "\t"))
+                if len(fields) < 2 {
+                    fields = removeEmpty(strings.Split(line, " "))
+                }
+                if len(fields) >= 2 {
+                    uid = fields[1]
+                }
+                break
+            }
+        }
+    }
+
+    return &ProcRef{
+        Pid:  pid,
+        User: getUser(uid),
+        Name: name,
+        Exe:  exe,
+    }
+}
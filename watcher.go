@@ -0,0 +1,228 @@
+/*
+    Watcher turns the one-shot Tcp/Udp/Tcp6/Udp6 snapshots into a stream
+    of connection lifecycle events, so a caller can wire the package into
+    monitoring/alerting without reimplementing the diff/dedupe logic
+    itself.
+
+    Author: Rafael Santos <rafael@sourcecode.net.br>
+*/
+
+package GOnetstat
+
+import (
+    "context"
+    "fmt"
+    "time"
+)
+
+type EventKind int
+
+const (
+    Added EventKind = iota
+    Removed
+    StateChanged
+)
+
+
+func (k EventKind) String() string {
+    switch k {
+    case Added:
+        return "Added"
+    case Removed:
+        return "Removed"
+    case StateChanged:
+        return "StateChanged"
+    default:
+        return "Unknown"
+    }
+}
+
+
+// Event describes a single change observed between two polls of the
+// socket table. Prev is the zero Process for Added, Curr is the zero
+// Process for Removed.
+type Event struct {
+    Kind EventKind
+    Prev Process
+    Curr Process
+}
+
+
+// WatchOptions configures a Watcher.
+type WatchOptions struct {
+    // Interval between polls. Defaults to 2 seconds if zero.
+    Interval time.Duration
+
+    // CoalesceTimeWait, when non-zero, suppresses the Added/Removed pair
+    // for a socket that is first observed already in TIME_WAIT and
+    // disappears again within this window, so a busy host doesn't flood
+    // the channel with churn from connections that live out their whole
+    // TIME_WAIT in the gap between two polls. The Added is held back
+    // rather than sent immediately; if the socket is still there once
+    // the window elapses, the held Added is sent late and the socket
+    // starts being tracked normally.
+    CoalesceTimeWait time.Duration
+}
+
+
+type socketKey struct {
+    Proto       string
+    LocalIP     string
+    LocalPort   int64
+    ForeignIP   string
+    ForeignPort int64
+}
+
+func keyOf(proto string, p Process) socketKey {
+    return socketKey{
+        Proto:       proto,
+        LocalIP:     p.IP,
+        LocalPort:   p.Port,
+        ForeignIP:   p.ForeignIP,
+        ForeignPort: p.ForeignPort,
+    }
+}
+
+
+// Watch polls the TCP and UDP socket tables on opts.Interval and emits an
+// Event for every socket added, removed, or whose State changed between
+// polls. The returned channel is closed when ctx is done.
+func Watch(ctx context.Context, opts WatchOptions) (<-chan Event, error) {
+    if opts.Interval <= 0 {
+        opts.Interval = 2 * time.Second
+    }
+
+    events := make(chan Event)
+
+    go func() {
+        defer close(events)
+
+        known := make(map[socketKey]Process)
+        pendingRemoval := make(map[socketKey]time.Time)
+        pendingAdd := make(map[socketKey]pendingAdd)
+
+        ticker := time.NewTicker(opts.Interval)
+        defer ticker.Stop()
+
+        for {
+            snapshot, err := snapshotAll(ctx)
+            if err == nil {
+                diffSnapshot(known, pendingRemoval, pendingAdd, snapshot, opts, events, ctx)
+            }
+
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+            }
+        }
+    }()
+
+    return events, nil
+}
+
+
+// snapshotAll gathers every socket this package knows how to enumerate
+// into a single keyed map, building the inode index once for the whole
+// poll.
+func snapshotAll(ctx context.Context) (map[socketKey]Process, error) {
+    index, err := BuildInodeIndexContext(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("build inode index: %w", err)
+    }
+
+    snapshot := make(map[socketKey]Process)
+
+    for proto, fetch := range map[string]func(map[uint64]ProcRef) ([]Process, error){
+        "tcp":  TcpWithIndex,
+        "udp":  UdpWithIndex,
+        "tcp6": Tcp6WithIndex,
+        "udp6": Udp6WithIndex,
+    } {
+        procs, err := fetch(index)
+        if err != nil {
+            return nil, fmt.Errorf("snapshot %s: %w", proto, err)
+        }
+        for _, p := range procs {
+            snapshot[keyOf(proto, p)] = p
+        }
+    }
+
+    return snapshot, nil
+}
+
+
+// pendingAdd holds an Added event for a socket first observed already in
+// TIME_WAIT, until CoalesceTimeWait decides whether to send it late or
+// drop it along with the matching Removed.
+type pendingAdd struct {
+    Curr  Process
+    Since time.Time
+}
+
+// diffSnapshot compares a freshly polled snapshot against the known state,
+// emits Added/Removed/StateChanged events, and folds the snapshot back
+// into known for the next tick.
+func diffSnapshot(known map[socketKey]Process, pendingRemoval map[socketKey]time.Time, pendingAdds map[socketKey]pendingAdd, snapshot map[socketKey]Process, opts WatchOptions, events chan<- Event, ctx context.Context) {
+    for key, curr := range snapshot {
+        prev, existed := known[key]
+        delete(pendingRemoval, key)
+
+        if !existed {
+            if _, held := pendingAdds[key]; held {
+                continue
+            }
+
+            if opts.CoalesceTimeWait > 0 && curr.State == SOCKET_STATE_TIME_WAIT {
+                pendingAdds[key] = pendingAdd{Curr: curr, Since: time.Now()}
+                continue
+            }
+
+            send(events, Event{Kind: Added, Curr: curr}, ctx)
+        } else if prev.State != curr.State {
+            send(events, Event{Kind: StateChanged, Prev: prev, Curr: curr}, ctx)
+        }
+        known[key] = curr
+    }
+
+    for key, add := range pendingAdds {
+        if _, stillThere := snapshot[key]; !stillThere {
+            // Lived out its whole TIME_WAIT between polls: suppress both
+            // the Added and the Removed.
+            delete(pendingAdds, key)
+            continue
+        }
+        if time.Since(add.Since) >= opts.CoalesceTimeWait {
+            send(events, Event{Kind: Added, Curr: add.Curr}, ctx)
+            known[key] = snapshot[key]
+            delete(pendingAdds, key)
+        }
+    }
+
+    for key, prev := range known {
+        if _, stillThere := snapshot[key]; stillThere {
+            continue
+        }
+
+        if opts.CoalesceTimeWait > 0 && prev.State == SOCKET_STATE_TIME_WAIT {
+            if first, pending := pendingRemoval[key]; !pending {
+                pendingRemoval[key] = time.Now()
+                continue
+            } else if time.Since(first) < opts.CoalesceTimeWait {
+                continue
+            }
+        }
+
+        send(events, Event{Kind: Removed, Prev: prev}, ctx)
+        delete(known, key)
+        delete(pendingRemoval, key)
+    }
+}
+
+
+func send(events chan<- Event, e Event, ctx context.Context) {
+    select {
+    case events <- e:
+    case <-ctx.Done():
+    }
+}